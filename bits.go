@@ -0,0 +1,101 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+// bitWriter accumulates a big-endian, MSB-first bitstream, letting
+// encodeTokens pack successor IDs into fewer than eight bits each
+// instead of spending a whole byte per ID. Mixing in byte-aligned data
+// (a literal run's length and content) requires aligning first; writeByte
+// and writeBytes do that automatically.
+type bitWriter struct {
+	buf   []byte
+	nbits uint
+}
+
+// writeBits appends the low n bits of v, most significant bit first.
+func (w *bitWriter) writeBits(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		byteIndex := int(w.nbits / 8)
+		for len(w.buf) <= byteIndex {
+			w.buf = append(w.buf, 0)
+		}
+		if (v>>uint(i))&1 != 0 {
+			w.buf[byteIndex] |= 1 << uint(7-w.nbits%8)
+		}
+		w.nbits++
+	}
+}
+
+// align pads with zero bits up to the next byte boundary, a no-op if
+// already aligned.
+func (w *bitWriter) align() {
+	if r := w.nbits % 8; r != 0 {
+		w.writeBits(0, 8-r)
+	}
+}
+
+// writeBytes aligns to a byte boundary, then appends p verbatim.
+func (w *bitWriter) writeBytes(p []byte) {
+	w.align()
+	w.buf = append(w.buf, p...)
+	w.nbits = uint(len(w.buf)) * 8
+}
+
+// bytes aligns to a byte boundary (zero-padding the final partial byte,
+// if any) and returns the accumulated bitstream.
+func (w *bitWriter) bytes() []byte {
+	w.align()
+	return w.buf
+}
+
+// bitReader reads back a bitstream written by bitWriter.
+type bitReader struct {
+	buf   []byte
+	nbits uint
+}
+
+// readBits reads n bits, most significant bit first, reporting false if
+// that would run past the end of buf.
+func (r *bitReader) readBits(n uint) (uint64, bool) {
+	var v uint64
+	for i := uint(0); i < n; i++ {
+		byteIndex := int(r.nbits / 8)
+		if byteIndex >= len(r.buf) {
+			return 0, false
+		}
+		bit := (r.buf[byteIndex] >> uint(7-r.nbits%8)) & 1
+		v = v<<1 | uint64(bit)
+		r.nbits++
+	}
+	return v, true
+}
+
+// align skips forward to the next byte boundary, a no-op if already
+// aligned.
+func (r *bitReader) align() {
+	if rem := r.nbits % 8; rem != 0 {
+		r.nbits += 8 - rem
+	}
+}
+
+// readBytes aligns to a byte boundary, then reads the next n bytes
+// verbatim, reporting false if that would run past the end of buf.
+func (r *bitReader) readBytes(n int) ([]byte, bool) {
+	r.align()
+	start := int(r.nbits / 8)
+	if start+n > len(r.buf) {
+		return nil, false
+	}
+	r.nbits += uint(n) * 8
+	return r.buf[start : start+n], true
+}
+
+// bytesConsumed rounds the number of bits read so far up to a whole
+// number of bytes - the offset at which byte-aligned data following the
+// bitstream (e.g. an entropy tail's FSE block) begins.
+func (r *bitReader) bytesConsumed() int {
+	return int((r.nbits + 7) / 8)
+}
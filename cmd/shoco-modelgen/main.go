@@ -0,0 +1,75 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Command shoco-modelgen trains a *shoco.Model from a corpus and writes
+// it out either as a binary model file (gob-encoded) or as a Go source
+// file suitable for vendoring under models/.
+//
+// Usage:
+//
+//	shoco-modelgen -corpus words.txt -out model.bin
+//	shoco-modelgen -corpus words.txt -go -pkg models -func WordsEn -out models/words_en.go
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/storskegg/shoco/modelgen"
+)
+
+func main() {
+	var (
+		corpusPath = flag.String("corpus", "", "path to the training corpus (required)")
+		outPath    = flag.String("out", "", "path to write the model to (required)")
+		asGo       = flag.Bool("go", false, "emit Go source instead of a binary model file")
+		pkg        = flag.String("pkg", "models", "package name for -go output")
+		funcName   = flag.String("func", "Model", "exported constructor name for -go output")
+		maxSucc    = flag.Int("max-successor-id", 0, "cap on successor IDs per predecessor byte (0 = default)")
+		minFreq    = flag.Int("min-byte-frequency", 0, "minimum occurrences for a byte to be eligible (0 = default)")
+		entropy    = flag.Bool("entropy-tail", false, "bake in a byte histogram and enable the FSE entropy tail")
+	)
+	flag.Parse()
+
+	if *corpusPath == "" || *outPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	corpus, err := os.Open(*corpusPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer corpus.Close()
+
+	model, stats, err := modelgen.Train(corpus, modelgen.TrainOptions{
+		MaxSuccessorID:        *maxSucc,
+		MinByteFrequency:      *minFreq,
+		BuildEntropyHistogram: *entropy,
+	})
+	if err != nil {
+		log.Fatalf("training failed: %v", err)
+	}
+	fmt.Printf("trained on %d bytes, sample ratio %.2f%% (%d -> %d bytes)\n",
+		stats.CorpusBytes, stats.Ratio*100, stats.SampledBytes, stats.SampledCompressedBytes)
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	if *asGo {
+		err = modelgen.WriteGoSource(out, *pkg, *funcName, model)
+	} else {
+		err = gob.NewEncoder(out).Encode(model)
+	}
+	if err != nil {
+		log.Fatalf("writing %s: %v", *outPath, err)
+	}
+}
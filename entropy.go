@@ -0,0 +1,152 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/storskegg/shoco/internal/fse"
+)
+
+// ErrNoEntropyHistogram is returned by compressWithEntropyTail and
+// decompressEntropyTail when the model has EntropyTailEnabled set but no
+// EntropyHistogram (see modelgen's Train, which bakes one in from the
+// training corpus).
+var ErrNoEntropyHistogram = errors.New("shoco: model has no entropy histogram")
+
+// WithEntropyTail returns a copy of m with its entropy-coded fallback
+// tail enabled or disabled. When enabled, Compress may append an
+// FSE-coded block covering the literal-run bytes the ordinary pass
+// couldn't fold into successor tables, whenever that's smaller than
+// emitting those bytes inline - useful for non-English or mixed-alphabet
+// text, where shoco's literal fallback otherwise dominates the output
+// size. The existing wire format is unchanged when this doesn't help,
+// so current output stays byte-identical unless EntropyTailEnabled is
+// set and an EntropyHistogram is present.
+func (m *Model) WithEntropyTail(enable bool) *Model {
+	clone := *m
+	clone.EntropyTailEnabled = enable
+	return &clone
+}
+
+// compressWithEntropyTail builds the entropy-tailed encoding of in and
+// reports whether it ended up smaller than the plain token stream; if
+// not, the caller should fall back to Compress's plain path.
+func (m *Model) compressWithEntropyTail(in []byte) ([]byte, bool) {
+	stream, literalBytes := m.encodeTokens(in, true)
+	if len(literalBytes) == 0 {
+		return nil, false
+	}
+
+	fseBlock, err := encodeEntropyTail(m.EntropyHistogram, literalBytes)
+	if err != nil {
+		return nil, false
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(stream)))
+
+	out := make([]byte, 0, 1+n+len(stream)+len(fseBlock))
+	out = append(out, streamFlagEntropyTail)
+	out = append(out, lenBuf[:n]...)
+	out = append(out, stream...)
+	out = append(out, fseBlock...)
+
+	// The plain (non-externalized) stream's length would be exactly
+	// len(stream)+len(literalBytes): encodeTokens writes every literal
+	// run's bytes inline via the same byte-aligning writeBytes call it
+	// uses for externalized runs' length prefix, so the only difference
+	// between the two passes is those len(literalBytes) inline bytes -
+	// no need to re-run the matching loop just to measure it.
+	plainLen := len(stream) + len(literalBytes)
+	if len(out) >= 1+plainLen {
+		return nil, false
+	}
+	return out, true
+}
+
+// decompressEntropyTail reverses compressWithEntropyTail's layout (in
+// already has Decompress's leading flags byte stripped):
+//
+//	varint(len(token_stream)) || token_stream || fse_block
+//
+// The explicit length is needed because fseBlock must be FSE-decoded
+// first, to recover the literal-run bytes decodeTokens needs, before
+// decodeTokens can consume token_stream - so token_stream's end can't be
+// found by decoding it, the way the plain (no entropy tail) path does.
+func (m *Model) decompressEntropyTail(in []byte) ([]byte, error) {
+	if m.EntropyHistogram == nil {
+		return nil, ErrNoEntropyHistogram
+	}
+
+	streamLen, n := binary.Uvarint(in)
+	if n <= 0 {
+		return nil, ErrCorruptToken
+	}
+	in = in[n:]
+
+	if uint64(len(in)) < streamLen {
+		return nil, ErrCorruptToken
+	}
+	stream, fseBlock := in[:streamLen], in[streamLen:]
+
+	literalBytes, err := decodeEntropyTail(m.EntropyHistogram, fseBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := m.decodeTokens(stream, literalBytes)
+	return out, err
+}
+
+// encodeEntropyTail FSE-codes in against counts. Layout:
+// varint(len(in)) || finalState (4 bytes, big-endian) || fse-coded bytes.
+func encodeEntropyTail(counts *[256]uint32, in []byte) ([]byte, error) {
+	table, err := fse.NewTable(*counts, fse.MaxTableLog)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := fse.NewEncoder(table)
+	for i := len(in) - 1; i >= 0; i-- {
+		enc.PushSymbol(in[i])
+	}
+	coded, finalState := enc.Finish()
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(in)))
+
+	out := make([]byte, 0, n+4+len(coded))
+	out = append(out, lenBuf[:n]...)
+
+	var stateBuf [4]byte
+	binary.BigEndian.PutUint32(stateBuf[:], finalState)
+	out = append(out, stateBuf[:]...)
+
+	return append(out, coded...), nil
+}
+
+func decodeEntropyTail(counts *[256]uint32, block []byte) ([]byte, error) {
+	table, err := fse.NewTable(*counts, fse.MaxTableLog)
+	if err != nil {
+		return nil, err
+	}
+
+	uncompressedLen, n := binary.Uvarint(block)
+	if n <= 0 {
+		return nil, ErrCorruptToken
+	}
+	block = block[n:]
+
+	if len(block) < 4 {
+		return nil, ErrCorruptToken
+	}
+	finalState := binary.BigEndian.Uint32(block[:4])
+	block = block[4:]
+
+	return fse.Decode(table, block, finalState, int(uncompressedLen)), nil
+}
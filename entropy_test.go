@@ -0,0 +1,86 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+import (
+	"testing"
+
+	"github.com/storskegg/shoco/internal/fse"
+)
+
+// textHistogram returns a histogram over every byte value, weighted
+// toward a small sample corpus, normalized so fse.NewTable accepts it.
+func textHistogram() *[256]uint32 {
+	var raw [256]uint64
+	for _, b := range []byte("the quick brown fox jumps over the lazy dog 0123456789") {
+		raw[b]++
+	}
+	for b := range raw {
+		if raw[b] == 0 {
+			raw[b] = 1
+		}
+	}
+
+	counts := fse.NormalizeCounts(raw, fse.MaxTableLog)
+	return &counts
+}
+
+func TestEntropyTailDisabledIsPlainPassthrough(t *testing.T) {
+	m := &Model{}
+
+	in := []byte("hello")
+	out := m.Compress(in)
+	if len(out) > 0 && out[0] == streamFlagEntropyTail {
+		t.Fatalf("entropy tail flag set with EntropyTailEnabled false")
+	}
+
+	back, err := m.Decompress(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != string(in) {
+		t.Fatalf("got %q, want %q", back, in)
+	}
+}
+
+func TestEntropyTailRoundTrip(t *testing.T) {
+	m := &Model{EntropyTailEnabled: true, EntropyHistogram: textHistogram()}
+
+	for _, in := range [][]byte{
+		[]byte(""),
+		[]byte("the quick brown fox"),
+		[]byte("Übergrößenträger"),
+		[]byte("世界"),
+	} {
+		out := m.Compress(in)
+
+		back, err := m.Decompress(out)
+		if err != nil {
+			t.Fatalf("Decompress(Compress(%q)): %v", in, err)
+		}
+		if string(back) != string(in) {
+			t.Fatalf("got %q, want %q", back, in)
+		}
+	}
+}
+
+func TestEntropyTailMissingHistogramFallsBackToPlain(t *testing.T) {
+	m := &Model{EntropyTailEnabled: true}
+
+	in := []byte("x")
+	out := m.Compress(in)
+	if len(out) > 0 && out[0] == streamFlagEntropyTail {
+		t.Fatalf("entropy tail flag set with no EntropyHistogram")
+	}
+
+	back, err := m.Decompress(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(back) != string(in) {
+		t.Fatalf("got %q, want %q", back, in)
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// frameMagic identifies a shoco frame stream, in the same spirit as
+// Snappy's framing format and zstd's skippable frames. It's chosen to be
+// unlikely to collide with other formats and to fail fast if a reader is
+// pointed at something else.
+var frameMagic = [4]byte{0x73, 0x68, 0x6f, 0x01} // "sho" + version 1
+
+// ErrBadFrameMagic is returned by NewFrameReader and Next when the
+// stream doesn't start with, or loses sync with, the shoco frame magic.
+var ErrBadFrameMagic = errors.New("shoco: bad frame magic")
+
+// ErrFrameChecksum is returned by Next when a frame's checksum doesn't
+// match its contents.
+var ErrFrameChecksum = errors.New("shoco: frame checksum mismatch")
+
+// ErrUnknownModelName is returned by Next when a frame's model
+// directory names a model the FrameReader wasn't given a lookup for.
+var ErrUnknownModelName = errors.New("shoco: frame references unknown model name")
+
+// ErrModelNameConflict is returned by WriteRecord when two distinct
+// *Model values sharing the same Name are used in the same frame.
+// FrameReader resolves a frame's model directory by Name alone, so two
+// entries with the same name would be indistinguishable on the wire -
+// records meant for one *Model would silently decode against the
+// other.
+var ErrModelNameConflict = errors.New("shoco: two distinct models share a Name in one frame")
+
+// modelID identifies, within a single frame, which entry of that
+// frame's model directory a record was compressed with.
+type modelID = byte
+
+// FrameWriter writes a stream of independently length-prefixed records,
+// grouped into checksummed frames, for bulk storage of many short
+// strings (e.g. log lines or keys) rather than a single long payload.
+//
+// Each frame is self-describing: it opens with a directory listing the
+// Model.Name of every model used by a record in that frame, so a
+// FrameReader never has to be told out of band, in a specific order,
+// which models a stream was written with - it resolves each frame's
+// directory by name against the models it was given. A frame on the
+// wire is:
+//
+//	magic || varint(frame_len) || frame_payload || crc32(frame_payload)
+//
+// frame_payload is:
+//
+//	varint(num_models) || num_models * {varint(len(name)) || name} ||
+//	records* where each record is
+//	varint(uncompressed_len) || varint(compressed_len) || model_id (1 byte) || payload
+//
+// model_id indexes into that frame's own directory, not a global or
+// cross-frame numbering.
+type FrameWriter struct {
+	w       *bufio.Writer
+	models  map[string]modelID
+	byName  map[string]*Model
+	order   []*Model
+	buf     []byte
+	lenBuf  [binary.MaxVarintLen64]byte
+	started bool
+}
+
+// frameTargetSize is the approximate number of payload bytes collected
+// before a frame is flushed automatically. It's a soft target, not a
+// hard cap: a single oversized record is never split across frames.
+const frameTargetSize = 64 << 10
+
+// NewFrameWriter returns a FrameWriter that writes to w.
+func NewFrameWriter(w io.Writer) *FrameWriter {
+	return &FrameWriter{
+		w:      bufio.NewWriter(w),
+		models: make(map[string]modelID),
+		byName: make(map[string]*Model),
+	}
+}
+
+// WriteRecord compresses p with model and appends it to the current
+// frame, recording model's Name in that frame's directory the first
+// time it's seen. model.Name must be non-empty: an anonymous model
+// can't be named on the wire for a reader to look back up. Models are
+// deduped by Name, not by pointer identity, to match how FrameReader
+// resolves a frame's directory - WriteRecord returns
+// ErrModelNameConflict if two distinct *Model values sharing a Name are
+// used in the same frame, rather than letting the second one silently
+// shadow the first. It automatically flushes the current frame once
+// enough records have accumulated; call Flush or Close to force a
+// partial frame out.
+func (fw *FrameWriter) WriteRecord(p []byte, model *Model) error {
+	if model.Name == "" {
+		return errors.New("shoco: WriteRecord requires model.Name to be set")
+	}
+
+	if !fw.started {
+		if _, err := fw.w.Write(frameMagic[:]); err != nil {
+			return err
+		}
+		fw.started = true
+	}
+
+	id, ok := fw.models[model.Name]
+	if !ok {
+		if len(fw.order) >= 1<<8-1 {
+			return errors.New("shoco: too many distinct models for one frame")
+		}
+		id = modelID(len(fw.order))
+		fw.models[model.Name] = id
+		fw.byName[model.Name] = model
+		fw.order = append(fw.order, model)
+	} else if fw.byName[model.Name] != model {
+		return fmt.Errorf("%w: %q", ErrModelNameConflict, model.Name)
+	}
+
+	compressed := model.Compress(p)
+
+	n := binary.PutUvarint(fw.lenBuf[:], uint64(len(p)))
+	fw.buf = append(fw.buf, fw.lenBuf[:n]...)
+	n = binary.PutUvarint(fw.lenBuf[:], uint64(len(compressed)))
+	fw.buf = append(fw.buf, fw.lenBuf[:n]...)
+	fw.buf = append(fw.buf, id)
+	fw.buf = append(fw.buf, compressed...)
+
+	if len(fw.buf) >= frameTargetSize {
+		return fw.Flush()
+	}
+	return nil
+}
+
+// Flush writes any buffered records out as one frame, prefixed with
+// that frame's model directory. It is a no-op if no records are
+// buffered.
+func (fw *FrameWriter) Flush() error {
+	if len(fw.buf) == 0 {
+		return fw.w.Flush()
+	}
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	payload := make([]byte, 0, len(fw.buf)+32)
+
+	n := binary.PutUvarint(lenBuf[:], uint64(len(fw.order)))
+	payload = append(payload, lenBuf[:n]...)
+	for _, model := range fw.order {
+		n := binary.PutUvarint(lenBuf[:], uint64(len(model.Name)))
+		payload = append(payload, lenBuf[:n]...)
+		payload = append(payload, model.Name...)
+	}
+	payload = append(payload, fw.buf...)
+
+	n = binary.PutUvarint(lenBuf[:], uint64(len(payload)))
+	if _, err := fw.w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	if _, err := fw.w.Write(payload); err != nil {
+		return err
+	}
+
+	var crcBuf [4]byte
+	binary.BigEndian.PutUint32(crcBuf[:], crc32.ChecksumIEEE(payload))
+	if _, err := fw.w.Write(crcBuf[:]); err != nil {
+		return err
+	}
+
+	fw.buf = fw.buf[:0]
+	fw.models = make(map[string]modelID)
+	fw.byName = make(map[string]*Model)
+	fw.order = nil
+	return fw.w.Flush()
+}
+
+// Close flushes any remaining records and flushes the underlying
+// writer. It does not close the underlying io.Writer.
+func (fw *FrameWriter) Close() error {
+	return fw.Flush()
+}
+
+// FrameReader reads a stream written by FrameWriter, handing back one
+// decompressed record at a time via Next.
+type FrameReader struct {
+	r      *bufio.Reader
+	lookup map[string]*Model
+	frame  []byte
+	synced bool
+	models []*Model // this frame's directory, resolved via lookup
+}
+
+// NewFrameReader returns a FrameReader that reads frames from r. Each
+// frame names the models it used by Model.Name; lookup must map every
+// name a frame might reference to the *Model it names (for example,
+// keyed by the same names models.WordsEn, models.Emails, and so on set
+// on the models they return). A frame referencing a name missing from
+// lookup fails with ErrUnknownModelName rather than silently decoding
+// against the wrong model.
+func NewFrameReader(r io.Reader, lookup map[string]*Model) *FrameReader {
+	return &FrameReader{r: bufio.NewReader(r), lookup: lookup}
+}
+
+// Next returns the next decompressed record in the stream, reading and
+// validating additional frames as needed. It returns io.EOF once the
+// stream is exhausted.
+func (fr *FrameReader) Next() ([]byte, error) {
+	if !fr.synced {
+		var magic [4]byte
+		if _, err := io.ReadFull(fr.r, magic[:]); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, unexpectedEOF(err)
+		}
+		if magic != frameMagic {
+			return nil, ErrBadFrameMagic
+		}
+		fr.synced = true
+	}
+
+	for len(fr.frame) == 0 {
+		if err := fr.nextFrame(); err != nil {
+			return nil, err
+		}
+	}
+
+	uncompressedLen, n1 := binary.Uvarint(fr.frame)
+	if n1 <= 0 {
+		return nil, ErrBadFrameMagic
+	}
+	rest := fr.frame[n1:]
+
+	compressedLen, n2 := binary.Uvarint(rest)
+	if n2 <= 0 {
+		return nil, ErrBadFrameMagic
+	}
+	rest = rest[n2:]
+
+	if len(rest) < 1+int(compressedLen) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	id := rest[0]
+	compressed := rest[1 : 1+int(compressedLen)]
+	fr.frame = rest[1+int(compressedLen):]
+
+	if int(id) >= len(fr.models) {
+		return nil, fmt.Errorf("shoco: record references unknown model ID %d", id)
+	}
+
+	out, err := fr.models[id].Decompress(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) != uncompressedLen {
+		return nil, ErrCorruptRecord
+	}
+	return out, nil
+}
+
+func (fr *FrameReader) nextFrame() error {
+	frameLen, err := binary.ReadUvarint(fr.r)
+	if err != nil {
+		return err // io.EOF here means a clean end of stream.
+	}
+
+	payload := make([]byte, frameLen)
+	if _, err := io.ReadFull(fr.r, payload); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	var crcBuf [4]byte
+	if _, err := io.ReadFull(fr.r, crcBuf[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(crcBuf[:]) {
+		return ErrFrameChecksum
+	}
+
+	numModels, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return ErrBadFrameMagic
+	}
+	payload = payload[n:]
+
+	models := make([]*Model, numModels)
+	for i := range models {
+		nameLen, n := binary.Uvarint(payload)
+		if n <= 0 || uint64(len(payload)-n) < nameLen {
+			return ErrBadFrameMagic
+		}
+		payload = payload[n:]
+		name := string(payload[:nameLen])
+		payload = payload[nameLen:]
+
+		model, ok := fr.lookup[name]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownModelName, name)
+		}
+		models[i] = model
+	}
+
+	fr.models = models
+	fr.frame = payload
+	return nil
+}
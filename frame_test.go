@@ -0,0 +1,124 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/storskegg/shoco"
+	"github.com/storskegg/shoco/models"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	wordsModel := models.WordsEn()
+	emailsModel := models.Emails()
+
+	records := []struct {
+		data  string
+		model *shoco.Model
+	}{
+		{"shoco", wordsModel},
+		{"is", wordsModel},
+		{"a test", wordsModel},
+		{"user@example.com", emailsModel},
+	}
+
+	var buf bytes.Buffer
+	fw := shoco.NewFrameWriter(&buf)
+	for _, r := range records {
+		if err := fw.WriteRecord([]byte(r.data), r.model); err != nil {
+			t.Fatalf("WriteRecord(%q): %v", r.data, err)
+		}
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	fr := shoco.NewFrameReader(&buf, map[string]*shoco.Model{
+		wordsModel.Name:  wordsModel,
+		emailsModel.Name: emailsModel,
+	})
+	for i, want := range records {
+		got, err := fr.Next()
+		if err != nil {
+			t.Fatalf("record #%d: Next: %v", i, err)
+		}
+		if string(got) != want.data {
+			t.Fatalf("record #%d: got %q, want %q", i, got, want.data)
+		}
+	}
+
+	if _, err := fr.Next(); err != io.EOF {
+		t.Fatalf("got err %v, want io.EOF", err)
+	}
+}
+
+func TestFrameReaderRejectsBadMagic(t *testing.T) {
+	model := models.WordsEn()
+	fr := shoco.NewFrameReader(bytes.NewReader([]byte("not a shoco frame")), map[string]*shoco.Model{model.Name: model})
+	if _, err := fr.Next(); err != shoco.ErrBadFrameMagic {
+		t.Fatalf("got err %v, want ErrBadFrameMagic", err)
+	}
+}
+
+func TestFrameReaderDetectsCorruption(t *testing.T) {
+	model := models.WordsEn()
+
+	var buf bytes.Buffer
+	fw := shoco.NewFrameWriter(&buf)
+	if err := fw.WriteRecord([]byte("corrupt me"), model); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	fr := shoco.NewFrameReader(bytes.NewReader(corrupt), map[string]*shoco.Model{model.Name: model})
+	if _, err := fr.Next(); err != shoco.ErrFrameChecksum {
+		t.Fatalf("got err %v, want ErrFrameChecksum", err)
+	}
+}
+
+func TestFrameWriterRejectsConflictingModelName(t *testing.T) {
+	m1 := &shoco.Model{Name: "dup"}
+	m2 := &shoco.Model{Name: "dup"}
+
+	var buf bytes.Buffer
+	fw := shoco.NewFrameWriter(&buf)
+	if err := fw.WriteRecord([]byte("hello"), m1); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.WriteRecord([]byte("again"), m1); err != nil {
+		t.Fatalf("re-using the same *Model should succeed: %v", err)
+	}
+	if err := fw.WriteRecord([]byte("world"), m2); !errors.Is(err, shoco.ErrModelNameConflict) {
+		t.Fatalf("got err %v, want ErrModelNameConflict", err)
+	}
+}
+
+func TestFrameReaderRejectsUnknownModelName(t *testing.T) {
+	model := models.WordsEn()
+
+	var buf bytes.Buffer
+	fw := shoco.NewFrameWriter(&buf)
+	if err := fw.WriteRecord([]byte("shoco"), model); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fr := shoco.NewFrameReader(&buf, map[string]*shoco.Model{"SomeOtherModel": models.Emails()})
+	if _, err := fr.Next(); !errors.Is(err, shoco.ErrUnknownModelName) {
+		t.Fatalf("got err %v, want ErrUnknownModelName", err)
+	}
+}
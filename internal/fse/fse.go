@@ -0,0 +1,347 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package fse implements a table-based Asymmetric Numeral System
+// (tANS/FSE) entropy coder, used by shoco's optional entropy-coded
+// literal tail (see Model.WithEntropyTail). It is not a general-purpose
+// compressor: callers build a Table once from a fixed, baked-in
+// histogram and reuse it across many short Encode/Decode calls.
+package fse
+
+import (
+	"errors"
+	"math/bits"
+)
+
+const (
+	// MinTableLog and MaxTableLog bound the table sizes NewTable accepts.
+	MinTableLog = 5
+	MaxTableLog = 12
+)
+
+// ErrInvalidTableLog is returned by NewTable when tableLog is out of
+// [MinTableLog, MaxTableLog].
+var ErrInvalidTableLog = errors.New("fse: invalid table log")
+
+// ErrEmptyHistogram is returned by NewTable when every count is zero.
+var ErrEmptyHistogram = errors.New("fse: histogram is empty")
+
+// symbolInfo is one decode-table cell.
+type symbolInfo struct {
+	symbol   byte
+	nbBits   uint8
+	newState uint32
+}
+
+// Table holds the encode and decode transition tables for a fixed,
+// normalized symbol distribution, as used by shoco's entropy-coded
+// literal tail. A Table is built once per Model (from a histogram baked
+// in at model-generation time) and reused across many Encode/Decode
+// calls.
+type Table struct {
+	tableLog  uint
+	tableSize uint32
+
+	// encode side
+	deltaNbBits    [256]uint32
+	deltaFindState [256]int32
+	nextStateTable []uint32 // len tableSize, see NewTable
+
+	// decode side
+	decodeTable []symbolInfo // len tableSize
+}
+
+// NewTable builds a Table from a normalized histogram: counts[s] is the
+// number of table cells assigned to symbol s, and must sum to
+// 1<<tableLog. Use NormalizeCounts to derive such a histogram from raw
+// corpus frequencies.
+func NewTable(counts [256]uint32, tableLog uint) (*Table, error) {
+	if tableLog < MinTableLog || tableLog > MaxTableLog {
+		return nil, ErrInvalidTableLog
+	}
+
+	tableSize := uint32(1) << tableLog
+	var total uint32
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return nil, ErrEmptyHistogram
+	}
+	if total != tableSize {
+		return nil, errors.New("fse: counts do not sum to 1<<tableLog")
+	}
+
+	// Spread symbols across the table. This is the standard FSE
+	// placement: step = (tableSize>>1)+(tableSize>>3)+3 visits every
+	// cell exactly once as position wraps modulo tableSize (tableSize
+	// is a power of two and step is odd).
+	tableSymbol := make([]byte, tableSize)
+	step := (tableSize >> 1) + (tableSize >> 3) + 3
+	mask := tableSize - 1
+	pos := uint32(0)
+	for s := 0; s < 256; s++ {
+		for i := uint32(0); i < counts[s]; i++ {
+			tableSymbol[pos] = byte(s)
+			pos = (pos + step) & mask
+		}
+	}
+
+	t := &Table{
+		tableLog:       tableLog,
+		tableSize:      tableSize,
+		nextStateTable: make([]uint32, tableSize),
+		decodeTable:    make([]symbolInfo, tableSize),
+	}
+
+	// Decode table: for each cell in placement order, assign the
+	// symbol's next occurrence rank, from which nbBits/newState follow.
+	var cumulFreq [256]uint32
+	copy(cumulFreq[:], counts[:])
+	for i := uint32(0); i < tableSize; i++ {
+		s := tableSymbol[i]
+		nextState := cumulFreq[s]
+		cumulFreq[s]++
+
+		nbBits := uint8(tableLog) - uint8(bits.Len32(nextState)) + 1
+		newState := (nextState << nbBits) - tableSize
+
+		t.decodeTable[i] = symbolInfo{symbol: s, nbBits: nbBits, newState: newState}
+	}
+
+	// Encode tables: nextStateTable maps (rank within symbol) -> raw
+	// state number (offset by tableSize, per deltaFindState below), and
+	// deltaNbBits/deltaFindState let Encode compute the next state
+	// directly from the current state and the symbol being pushed.
+	var cumul [257]uint32
+	for s := 0; s < 256; s++ {
+		cumul[s+1] = cumul[s] + counts[s]
+	}
+	startOfSymbol := cumul
+	for i := uint32(0); i < tableSize; i++ {
+		s := tableSymbol[i]
+		t.nextStateTable[startOfSymbol[s]] = tableSize + i
+		startOfSymbol[s]++
+	}
+
+	var total2 int32
+	for s := 0; s < 256; s++ {
+		c := counts[s]
+		switch c {
+		case 0:
+			// Symbol absent; deltaNbBits/deltaFindState are never
+			// consulted for it.
+		case 1:
+			t.deltaNbBits[s] = (uint32(tableLog) << 16) - tableSize
+			t.deltaFindState[s] = total2 - 1
+			total2++
+		default:
+			maxBitsOut := tableLog - uint(bits.Len32(c-1)) + 1
+			minStatePlus := c << maxBitsOut
+			t.deltaNbBits[s] = (uint32(maxBitsOut) << 16) - minStatePlus
+			t.deltaFindState[s] = total2 - int32(c)
+			total2 += int32(c)
+		}
+	}
+
+	return t, nil
+}
+
+// NormalizeCounts scales raw symbol counts so they sum to exactly
+// 1<<tableLog, while keeping every symbol that appeared at least once
+// present with a count of at least 1 (so Encode never has to reject a
+// symbol that's actually in the input). It uses the largest-remainder
+// method to keep the rounding error small.
+func NormalizeCounts(raw [256]uint64, tableLog uint) [256]uint32 {
+	tableSize := uint64(1) << tableLog
+
+	var total uint64
+	present := 0
+	for _, c := range raw {
+		total += c
+		if c > 0 {
+			present++
+		}
+	}
+
+	var out [256]uint32
+	if total == 0 {
+		return out
+	}
+
+	type remainder struct {
+		sym int
+		rem uint64
+	}
+	remainders := make([]remainder, 0, present)
+
+	var assigned uint64
+	for s, c := range raw {
+		if c == 0 {
+			continue
+		}
+		scaled := c * tableSize / total
+		if scaled == 0 {
+			scaled = 1
+		}
+		out[s] = uint32(scaled)
+		assigned += scaled
+		remainders = append(remainders, remainder{s, (c * tableSize) % total})
+	}
+
+	// Adjust so the total is exactly tableSize: give (or take) one slot
+	// at a time to the symbols with the largest remainder (or, if we
+	// overshot, the smallest count above 1).
+	for assigned > tableSize {
+		// Take from the symbol with the most slots to spare.
+		maxIdx := -1
+		for i, r := range remainders {
+			if out[r.sym] > 1 && (maxIdx == -1 || out[r.sym] > out[remainders[maxIdx].sym]) {
+				maxIdx = i
+			}
+		}
+		if maxIdx == -1 {
+			break
+		}
+		out[remainders[maxIdx].sym]--
+		assigned--
+	}
+	for assigned < tableSize {
+		best := -1
+		for i, r := range remainders {
+			if best == -1 || r.rem > remainders[best].rem {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		out[remainders[best].sym]++
+		assigned++
+		remainders[best].rem = 0
+	}
+
+	return out
+}
+
+// bitGroup is the handful of low bits a single PushSymbol call emits,
+// recorded rather than packed immediately: the bits a push produces
+// must land in the final stream in the *reverse* of push order (the
+// most recently pushed symbol's bits are consumed first during Decode,
+// since Decode walks forward starting from the state the last push
+// produced), so packing is deferred to Finish.
+type bitGroup struct {
+	value  uint32
+	nbBits uint8
+}
+
+// Encoder accumulates symbols pushed in reverse (last-to-first) order
+// and produces the final FSE bitstream and terminal state via Finish.
+type Encoder struct {
+	t      *Table
+	state  uint32
+	pushes []bitGroup
+}
+
+// NewEncoder starts a new encode pass against t. Symbols must be pushed
+// via PushSymbol in reverse order (last input symbol first).
+func NewEncoder(t *Table) *Encoder {
+	return &Encoder{t: t, state: t.tableSize}
+}
+
+// PushSymbol encodes one symbol. Callers must push the input's symbols
+// starting from the last and ending at the first.
+func (e *Encoder) PushSymbol(symbol byte) {
+	t := e.t
+	nbBits := (e.state + t.deltaNbBits[symbol]) >> 16
+
+	e.pushes = append(e.pushes, bitGroup{
+		value:  e.state & ((1 << nbBits) - 1),
+		nbBits: uint8(nbBits),
+	})
+
+	e.state = t.nextStateTable[uint32(int32(t.deltaFindState[symbol])+int32(e.state>>nbBits))]
+}
+
+// Finish packs the recorded bit groups into the completed bitstream,
+// oldest-push-last (see bitGroup), and returns it along with the
+// terminal state. Decode needs both the stream and the terminal state
+// (passed out-of-band rather than embedded in the stream, since shoco
+// already has a record framing layer that carries lengths) to seed its
+// forward walk.
+func (e *Encoder) Finish() (stream []byte, finalState uint32) {
+	var out []byte
+	var bitBuf uint64
+	var nbBits uint
+
+	for i := len(e.pushes) - 1; i >= 0; i-- {
+		g := e.pushes[i]
+		bitBuf |= uint64(g.value) << nbBits
+		nbBits += uint(g.nbBits)
+		for nbBits >= 8 {
+			out = append(out, byte(bitBuf))
+			bitBuf >>= 8
+			nbBits -= 8
+		}
+	}
+	for nbBits > 0 {
+		out = append(out, byte(bitBuf))
+		bitBuf >>= 8
+		if nbBits >= 8 {
+			nbBits -= 8
+		} else {
+			nbBits = 0
+		}
+	}
+
+	// e.state lives in [tableSize, 2*tableSize) throughout encoding (see
+	// PushSymbol); normalize it back to a decodeTable index.
+	return out, e.state - e.t.tableSize
+}
+
+// Decode reverses an Encoder's output: given the bitstream, the
+// finalState Finish reported, and the number of symbols originally
+// encoded, it returns the symbols in their original forward order.
+func Decode(t *Table, stream []byte, finalState uint32, numSymbols int) []byte {
+	br := newBitReader(stream)
+	state := finalState
+
+	out := make([]byte, numSymbols)
+	for i := 0; i < numSymbols; i++ {
+		info := t.decodeTable[state]
+		out[i] = info.symbol
+		state = info.newState + br.read(uint(info.nbBits))
+	}
+	return out
+}
+
+// bitReader reads bits least-significant-bit first from a byte slice,
+// matching the order Encoder.Finish packed them in.
+type bitReader struct {
+	buf    []byte
+	pos    int
+	bitBuf uint64
+	nbBits uint
+}
+
+func newBitReader(buf []byte) *bitReader {
+	return &bitReader{buf: buf}
+}
+
+func (r *bitReader) read(n uint) uint32 {
+	for r.nbBits < n {
+		var b byte
+		if r.pos < len(r.buf) {
+			b = r.buf[r.pos]
+		}
+		r.pos++
+		r.bitBuf |= uint64(b) << r.nbBits
+		r.nbBits += 8
+	}
+	v := uint32(r.bitBuf & ((1 << n) - 1))
+	r.bitBuf >>= n
+	r.nbBits -= n
+	return v
+}
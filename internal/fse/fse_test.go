@@ -0,0 +1,111 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package fse
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func skewedHistogram() [256]uint64 {
+	var raw [256]uint64
+	// Skewed distribution: 'e' most common, long tail of rare bytes.
+	raw['e'] = 1000
+	raw['t'] = 800
+	raw['a'] = 700
+	raw['o'] = 600
+	raw['i'] = 500
+	raw['n'] = 400
+	raw[' '] = 900
+	for b := 0; b < 256; b++ {
+		if raw[b] == 0 {
+			raw[b] = 1
+		}
+	}
+	return raw
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	raw := skewedHistogram()
+	counts := NormalizeCounts(raw, MaxTableLog)
+
+	table, err := NewTable(counts, MaxTableLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := [][]byte{
+		[]byte(""),
+		[]byte("e"),
+		[]byte("the rain in spain"),
+		[]byte("eeeeeeeeeeeeeeeeeeeeee"),
+		bytes.Repeat([]byte{'z'}, 50),
+	}
+
+	for _, in := range inputs {
+		enc := NewEncoder(table)
+		for i := len(in) - 1; i >= 0; i-- {
+			enc.PushSymbol(in[i])
+		}
+		stream, finalState := enc.Finish()
+
+		out := Decode(table, stream, finalState, len(in))
+		if !bytes.Equal(out, in) {
+			t.Fatalf("round trip failed:\n in: %q\nout: %q", in, out)
+		}
+	}
+}
+
+func TestEncodeDecodeRandom(t *testing.T) {
+	raw := skewedHistogram()
+	counts := NormalizeCounts(raw, MaxTableLog)
+	table, err := NewTable(counts, MaxTableLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []byte("etaoin the rain in spain falls mainly zzz")
+
+	for trial := 0; trial < 200; trial++ {
+		n := rng.Intn(200)
+		in := make([]byte, n)
+		for i := range in {
+			in[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+
+		enc := NewEncoder(table)
+		for i := len(in) - 1; i >= 0; i-- {
+			enc.PushSymbol(in[i])
+		}
+		stream, finalState := enc.Finish()
+
+		out := Decode(table, stream, finalState, len(in))
+		if !bytes.Equal(out, in) {
+			t.Fatalf("trial %d: round trip failed:\n in: %q\nout: %q", trial, in, out)
+		}
+	}
+}
+
+func TestNormalizeCountsSumsToTableSize(t *testing.T) {
+	var raw [256]uint64
+	raw['e'] = 1000
+	raw['t'] = 800
+	raw['a'] = 700
+	raw[' '] = 900
+
+	for _, log := range []uint{MinTableLog, 8, MaxTableLog} {
+		counts := NormalizeCounts(raw, log)
+		var sum uint32
+		for _, c := range counts {
+			sum += c
+		}
+		if want := uint32(1) << log; sum != want {
+			t.Fatalf("tableLog=%d: counts sum to %d, want %d", log, sum, want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// PackLayout describes one of the variable-width "pack" formats a run of
+// successive characters can be folded into: how many successor bytes it
+// covers beyond the leading byte, and how many bits are spent encoding
+// each successor ID. A layout with fewer SuccessorBits can only stand in
+// for predecessor/successor pairs that landed in one of its first
+// 1<<SuccessorBits slots, so layouts that pack more characters together
+// are necessarily pickier about which runs qualify.
+type PackLayout struct {
+	// BytesPacked is the number of successor bytes this layout folds
+	// into one token, beyond the leading byte itself.
+	BytesPacked int
+
+	// SuccessorBits is the number of bits available to store each
+	// successor ID under this layout; a run only qualifies if every
+	// successor ID involved is less than 1<<SuccessorBits.
+	SuccessorBits uint
+}
+
+// defaultPackLayouts mirrors the classic 4/2/1-byte shoco pack formats:
+// the widest layout packs the most characters together but can only
+// address the 8 most common successors per predecessor, while the
+// narrowest layout packs a single character but can address up to 32.
+var defaultPackLayouts = []PackLayout{
+	{BytesPacked: 4, SuccessorBits: 3},
+	{BytesPacked: 2, SuccessorBits: 4},
+	{BytesPacked: 1, SuccessorBits: 5},
+}
+
+// maxSuccessorSlots is the width of each row of CharsByChrAndSuccessorID;
+// it bounds how many successors a single predecessor byte can have a
+// slot for, regardless of what any individual PackLayout can address.
+const maxSuccessorSlots = 16
+
+// Model holds the trained successor dictionary and pack-format
+// configuration that Compress and Decompress operate against. The zero
+// Model is valid: every table lookup misses, so Compress falls back to
+// literal runs for all input - correct, if not a useful compression
+// ratio. Use modelgen.Train to build a populated Model from a corpus,
+// or one of the models package's ready-made models.
+type Model struct {
+	// Name optionally identifies the model, e.g. for diagnostics or for
+	// FrameWriter/FrameReader to tell distinct models apart on the wire.
+	Name string
+
+	// CharsByChrAndSuccessorID and SuccessorIDsByChrAndChr are the
+	// trained dictionary: for predecessor byte c,
+	// CharsByChrAndSuccessorID[c] lists the bytes most likely to follow
+	// it, and SuccessorIDsByChrAndChr[c][s] is one more than s's index
+	// into that list, or zero if s never earned a slot - the zero value
+	// reserved this way means a zero-value Model correctly has no
+	// successors at all, rather than spuriously matching slot 0.
+	CharsByChrAndSuccessorID [256][maxSuccessorSlots]byte
+	SuccessorIDsByChrAndChr  [256][256]int8
+
+	// PackLayouts lists, widest reach first, the pack formats Compress
+	// will try. Defaults to defaultPackLayouts if nil.
+	PackLayouts []PackLayout
+
+	// EntropyTailEnabled and EntropyHistogram back the optional FSE
+	// entropy-coded fallback (see entropy.go and WithEntropyTail).
+	// EntropyHistogram is a normalized fse.NewTable-ready count table
+	// over literal-run bytes, typically baked in by modelgen.Train from
+	// the same corpus used to build the successor dictionary above.
+	EntropyTailEnabled bool
+	EntropyHistogram   *[256]uint32
+}
+
+func (m *Model) packLayouts() []PackLayout {
+	if len(m.PackLayouts) == 0 {
+		return defaultPackLayouts
+	}
+	return m.PackLayouts
+}
+
+// ErrCorruptToken is returned by Decompress when the compressed stream
+// contains a token this version of Decompress doesn't recognize, or
+// that runs past the end of the input.
+var ErrCorruptToken = errors.New("shoco: corrupt or truncated token")
+
+// tokenLiteral is the marker value for a literal run: varint(length)
+// followed by that many raw bytes (or, when an entropy tail is active,
+// by no bytes at all - the literal content instead lives in the
+// trailing FSE block). Pack tokens use marker values 1..len(layouts),
+// where layout index+1 picks packLayouts()[index]. The marker is stored
+// in markerBits(layouts) bits, not a whole byte, and - like a pack
+// token's successor IDs - shares a byte with neighboring tokens rather
+// than padding out to one; only a literal token's length and content
+// are byte-aligned.
+const tokenLiteral = 0
+
+// markerBits returns the number of bits needed to hold any token marker
+// for layouts: 0 (literal) through len(layouts) (the last pack layout).
+func markerBits(layouts []PackLayout) uint {
+	return uint(bits.Len(uint(len(layouts))))
+}
+
+// encodeTokens walks in and emits the bit-packed token stream
+// Decompress expects: maximal packable runs per packLayouts(), with
+// everything else folded into literal-run tokens. A pack token spends
+// markerBits(layouts) bits on its marker, 8 bits on its leading byte,
+// and SuccessorBits bits per successor ID it packs - never a whole byte
+// per ID - so a run that qualifies is always smaller than storing the
+// same bytes literally. When externalizeLiterals is true, literal
+// tokens carry only their length; their raw bytes are instead appended,
+// in order, to the returned literalBytes, for the caller to entropy-code
+// separately.
+//
+// The returned stream is varint(len(in)) followed by the bitstream,
+// zero-padded to a byte boundary; the length prefix lets decodeTokens
+// know when to stop, since the padding bits aren't otherwise
+// distinguishable from further tokens.
+func (m *Model) encodeTokens(in []byte, externalizeLiterals bool) (stream, literalBytes []byte) {
+	layouts := m.packLayouts()
+	mbits := markerBits(layouts)
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(in)))
+	stream = append(stream, lenBuf[:n]...)
+
+	var w bitWriter
+	flushLiteral := func(run []byte) {
+		if len(run) == 0 {
+			return
+		}
+		w.writeBits(tokenLiteral, mbits)
+		n := binary.PutUvarint(lenBuf[:], uint64(len(run)))
+		w.writeBytes(lenBuf[:n])
+		if externalizeLiterals {
+			literalBytes = append(literalBytes, run...)
+		} else {
+			w.writeBytes(run)
+		}
+	}
+
+	// tryLayout reports whether the run starting at in[i] fully matches
+	// layout, returning the successor IDs (0-indexed slots into
+	// CharsByChrAndSuccessorID) it would pack if so. SuccessorIDsByChrAndChr
+	// stores slot+1, reserving the zero value to mean "no slot", so a
+	// zero-value Model correctly has no successors at all.
+	tryLayout := func(i int, layout PackLayout) (ids []int8, ok bool) {
+		if i+layout.BytesPacked >= len(in) {
+			return nil, false
+		}
+		ids = make([]int8, layout.BytesPacked)
+		prev := in[i]
+		for k := 0; k < layout.BytesPacked; k++ {
+			stored := m.SuccessorIDsByChrAndChr[prev][in[i+1+k]]
+			if stored == 0 {
+				return nil, false
+			}
+			slot := stored - 1
+			if uint(slot) >= 1<<layout.SuccessorBits {
+				return nil, false
+			}
+			ids[k] = slot
+			prev = in[i+1+k]
+		}
+		return ids, true
+	}
+
+	var literalRun []byte
+	for i := 0; i < len(in); {
+		matched := false
+		for li, layout := range layouts {
+			ids, ok := tryLayout(i, layout)
+			if !ok {
+				continue
+			}
+
+			flushLiteral(literalRun)
+			literalRun = nil
+
+			w.writeBits(uint64(li+1), mbits)
+			w.writeBits(uint64(in[i]), 8)
+			for _, id := range ids {
+				w.writeBits(uint64(id), layout.SuccessorBits)
+			}
+			i += 1 + layout.BytesPacked
+			matched = true
+			break
+		}
+		if matched {
+			continue
+		}
+
+		literalRun = append(literalRun, in[i])
+		i++
+	}
+	flushLiteral(literalRun)
+
+	stream = append(stream, w.bytes()...)
+	return stream, literalBytes
+}
+
+// decodeTokens reverses encodeTokens. When literalBytes is non-nil, it
+// is treated as encodeTokens's externalized output: literal tokens in
+// stream carry no raw bytes of their own, and their content is instead
+// pulled from literalBytes in the order the tokens appear. It returns
+// the number of bytes of stream consumed, so callers that append more
+// data after the token stream (the entropy tail's FSE block) know where
+// that data starts.
+func (m *Model) decodeTokens(stream []byte, literalBytes []byte) (out []byte, consumed int, err error) {
+	layouts := m.packLayouts()
+	mbits := markerBits(layouts)
+	externalized := literalBytes != nil
+
+	total, n := binary.Uvarint(stream)
+	if n <= 0 {
+		return nil, 0, ErrCorruptToken
+	}
+
+	r := bitReader{buf: stream[n:]}
+
+	// Every token spends at least one bit per output byte it produces
+	// (the marker alone costs mbits >= 1, and no layout gets cheaper
+	// than that per byte), so total can never legitimately exceed the
+	// number of bits left in the stream. Reject it up front rather than
+	// trusting an attacker-controlled varint as a preallocation size.
+	if maxPossible := uint64(len(r.buf)) * 8; total > maxPossible {
+		return nil, 0, ErrCorruptToken
+	}
+	out = make([]byte, 0, total)
+
+	for uint64(len(out)) < total {
+		marker, ok := r.readBits(mbits)
+		if !ok {
+			return nil, 0, ErrCorruptToken
+		}
+
+		if marker == tokenLiteral {
+			lenBytes, ok := r.readBytes(binary.MaxVarintLen64)
+			if !ok {
+				lenBytes, ok = r.readBytes(len(r.buf) - r.bytesConsumed())
+				if !ok {
+					return nil, 0, ErrCorruptToken
+				}
+			}
+			length, ln := binary.Uvarint(lenBytes)
+			if ln <= 0 {
+				return nil, 0, ErrCorruptToken
+			}
+			r.nbits -= uint(len(lenBytes)-ln) * 8
+
+			if externalized {
+				if uint64(len(literalBytes)) < length {
+					return nil, 0, ErrCorruptToken
+				}
+				out = append(out, literalBytes[:length]...)
+				literalBytes = literalBytes[length:]
+				continue
+			}
+
+			content, ok := r.readBytes(int(length))
+			if !ok {
+				return nil, 0, ErrCorruptToken
+			}
+			out = append(out, content...)
+			continue
+		}
+
+		li := int(marker) - 1
+		if li < 0 || li >= len(layouts) {
+			return nil, 0, ErrCorruptToken
+		}
+		layout := layouts[li]
+
+		lead, ok := r.readBits(8)
+		if !ok {
+			return nil, 0, ErrCorruptToken
+		}
+		prev := byte(lead)
+		out = append(out, prev)
+		for k := 0; k < layout.BytesPacked; k++ {
+			id, ok := r.readBits(layout.SuccessorBits)
+			if !ok || id >= maxSuccessorSlots {
+				return nil, 0, ErrCorruptToken
+			}
+			next := m.CharsByChrAndSuccessorID[prev][id]
+			out = append(out, next)
+			prev = next
+		}
+	}
+
+	// decodeTokens's length prefix means the loop above can stop well
+	// short of the end of stream without erroring on its own - so
+	// require every remaining byte to have been consumed (the writer
+	// never emits more than the single zero-padded partial byte that
+	// alignment requires), catching trailing garbage or a truncated
+	// re-encoding that Compress would never itself produce.
+	consumed = n + r.bytesConsumed()
+	if consumed != len(stream) {
+		return nil, 0, ErrCorruptToken
+	}
+
+	return out, consumed, nil
+}
+
+// streamFlagPlain and streamFlagEntropyTail are the leading byte
+// Compress always prepends to its output, ahead of the varint length
+// that starts the token stream proper. A dedicated flags byte - rather
+// than stealing a bit from that varint, whose own high bit already
+// means "more bytes follow" - keeps the two uses from colliding.
+const (
+	streamFlagPlain       = 0
+	streamFlagEntropyTail = 1
+)
+
+// Compress encodes in against m's successor dictionary, folding runs of
+// characters the model recognizes into compact pack tokens and leaving
+// everything else as literal-run tokens. An empty input compresses to
+// an empty output.
+func (m *Model) Compress(in []byte) []byte {
+	if len(in) == 0 {
+		return nil
+	}
+
+	if m.EntropyTailEnabled && m.EntropyHistogram != nil {
+		if out, ok := m.compressWithEntropyTail(in); ok {
+			return out
+		}
+	}
+
+	stream, _ := m.encodeTokens(in, false)
+	return append([]byte{streamFlagPlain}, stream...)
+}
+
+// Decompress reverses Compress. It returns ErrCorruptToken if in isn't a
+// valid token stream for m (including a stream produced by a different
+// Model, or with an entropy tail this build doesn't understand).
+func (m *Model) Decompress(in []byte) ([]byte, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+
+	flag, rest := in[0], in[1:]
+	switch flag {
+	case streamFlagEntropyTail:
+		return m.decompressEntropyTail(rest)
+	case streamFlagPlain:
+		out, _, err := m.decodeTokens(rest, nil)
+		return out, err
+	default:
+		return nil, ErrCorruptToken
+	}
+}
+
+// LiteralResidue returns the literal-run bytes Compress would leave
+// over for in after folding away everything its successor dictionary
+// recognizes - the same bytes an entropy tail FSE-codes (see
+// WithEntropyTail). modelgen's Train uses this to build
+// EntropyHistogram from the residue a trained Model's dictionary
+// actually leaves behind, rather than from the corpus's raw byte
+// frequency, since the two distributions differ once the dictionary
+// has siphoned off the predictable bigrams.
+func (m *Model) LiteralResidue(in []byte) []byte {
+	_, literalBytes := m.encodeTokens(in, true)
+	return literalBytes
+}
+
+// ProposedCompress is a conservative alternative to Compress that never
+// inspects byte values, so it carries no risk of mis-detecting a
+// multi-byte UTF-8 sequence as a recognized successor run (see
+// https://github.com/Ed-von-Schleck/shoco/issues/11, which this format
+// is named after). It simply length-prefixes in: varint(len(in)) || in.
+func (m *Model) ProposedCompress(in []byte) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(in)))
+	out := append([]byte(nil), lenBuf[:n]...)
+	return append(out, in...)
+}
+
+// ProposedDecompress reverses ProposedCompress.
+func (m *Model) ProposedDecompress(in []byte) ([]byte, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+
+	length, n := binary.Uvarint(in)
+	if n <= 0 {
+		return nil, ErrCorruptToken
+	}
+	rest := in[n:]
+	if uint64(len(rest)) != length {
+		return nil, ErrCorruptToken
+	}
+	return append([]byte(nil), rest...), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package modelgen
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/storskegg/shoco"
+)
+
+// WriteGoSource renders model as a Go source file declaring a single
+// exported func() *shoco.Model named funcName, in the same shape as the
+// hand-vendored models under the models package (see models.WordsEn,
+// models.TextEn, and so on). The generated file is self-contained aside
+// from the shoco import, so it can be dropped straight into models/.
+func WriteGoSource(w io.Writer, pkg, funcName string, model *shoco.Model) error {
+	bw := &errWriter{w: w}
+
+	bw.printf("// Code generated by shoco-modelgen. DO NOT EDIT.\n\n")
+	bw.printf("package %s\n\n", pkg)
+	bw.printf("import \"github.com/storskegg/shoco\"\n\n")
+	bw.printf("// %s returns a freshly trained *shoco.Model.\n", funcName)
+	bw.printf("func %s() *shoco.Model {\n", funcName)
+	bw.printf("\treturn &shoco.Model{\n")
+
+	if model.Name != "" {
+		bw.printf("\t\tName: %q,\n", model.Name)
+	}
+	bw.printf("\t\tCharsByChrAndSuccessorID: %s,\n", formatByteMatrix(model.CharsByChrAndSuccessorID[:]))
+	bw.printf("\t\tSuccessorIDsByChrAndChr: %s,\n", formatInt8Matrix(model.SuccessorIDsByChrAndChr[:]))
+	if len(model.PackLayouts) > 0 {
+		bw.printf("\t\tPackLayouts: %s,\n", formatPackLayouts(model.PackLayouts))
+	}
+	if model.EntropyHistogram != nil {
+		bw.printf("\t\tEntropyTailEnabled: %t,\n", model.EntropyTailEnabled)
+		bw.printf("\t\tEntropyHistogram: %s,\n", formatHistogram(model.EntropyHistogram))
+	}
+
+	bw.printf("\t}\n")
+	bw.printf("}\n")
+
+	return bw.err
+}
+
+func formatByteMatrix(rows [][16]byte) string {
+	s := "[256][16]byte{\n"
+	for _, row := range rows {
+		s += "\t\t\t{"
+		for i, b := range row {
+			if i > 0 {
+				s += ", "
+			}
+			s += fmt.Sprintf("%#02x", b)
+		}
+		s += "},\n"
+	}
+	s += "\t\t}"
+	return s
+}
+
+func formatInt8Matrix(rows [][256]int8) string {
+	s := "[256][256]int8{\n"
+	for _, row := range rows {
+		s += "\t\t\t{"
+		for i, v := range row {
+			if i > 0 {
+				s += ", "
+			}
+			s += fmt.Sprintf("%d", v)
+		}
+		s += "},\n"
+	}
+	s += "\t\t}"
+	return s
+}
+
+func formatPackLayouts(layouts []shoco.PackLayout) string {
+	s := "[]shoco.PackLayout{\n"
+	for _, l := range layouts {
+		s += fmt.Sprintf("\t\t\t{BytesPacked: %d, SuccessorBits: %d},\n", l.BytesPacked, l.SuccessorBits)
+	}
+	s += "\t\t}"
+	return s
+}
+
+func formatHistogram(counts *[256]uint32) string {
+	s := "&[256]uint32{\n\t\t\t"
+	for i, c := range counts {
+		if i > 0 {
+			s += ", "
+		}
+		if i > 0 && i%16 == 0 {
+			s += "\n\t\t\t"
+		}
+		s += fmt.Sprintf("%d", c)
+	}
+	s += ",\n\t\t}"
+	return s
+}
+
+// errWriter lets printf-style calls above ignore errors individually;
+// the first error is latched and every subsequent write becomes a no-op.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
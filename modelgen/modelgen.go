@@ -0,0 +1,228 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package modelgen builds a *shoco.Model from a training corpus, as an
+// alternative to vendoring the upstream generate_compression_model.py
+// output. It mirrors the upstream approach: count how often each byte
+// follows each other byte across the corpus, keep the most frequent
+// successors per predecessor, and pack them into the same
+// CharsByChrAndSuccessorID / SuccessorIDsByChrAndChr tables that
+// shoco.Model already consumes.
+package modelgen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/storskegg/shoco"
+	"github.com/storskegg/shoco/internal/fse"
+)
+
+// PackLayout describes one of the variable-width "pack" formats a
+// compressed word can be emitted as: how many successor bytes it covers,
+// how many bits are spent per successor ID, and how many bits are left
+// over for the leading byte index. It is an alias of shoco.PackLayout,
+// the type Model.PackLayouts and Model.Compress actually consume.
+type PackLayout = shoco.PackLayout
+
+// TrainOptions configures Train.
+type TrainOptions struct {
+	// MaxSuccessorID bounds how many distinct successor bytes are kept
+	// per predecessor byte; it is the size of each row of
+	// SuccessorIDsByChrAndChr. Defaults to 15 (matching upstream's
+	// 4-bit successor IDs) if zero.
+	MaxSuccessorID int
+
+	// PackLayouts lists the pack formats to fill, most specific first.
+	// Defaults to the upstream 1/2/4-byte layouts if nil.
+	PackLayouts []PackLayout
+
+	// MinByteFrequency discards predecessor/successor bytes that occur
+	// fewer than this many times in the corpus, so rare bytes (e.g. from
+	// a handful of foreign-language loanwords) don't crowd out a slot
+	// that a common byte could use. Defaults to 1 (no filtering).
+	MinByteFrequency int
+
+	// BuildEntropyHistogram bakes a byte histogram of the trained
+	// Model's literal-run residue (see shoco.Model.LiteralResidue) on a
+	// sample of the corpus into the trained Model's EntropyHistogram,
+	// and enables EntropyTailEnabled, so Model.Compress can fall back to
+	// FSE-coding the bytes its successor tables don't fold away. See
+	// Model.Compress and WithEntropyTail.
+	BuildEntropyHistogram bool
+}
+
+func (o TrainOptions) withDefaults() TrainOptions {
+	if o.MaxSuccessorID <= 0 {
+		o.MaxSuccessorID = 15
+	}
+	if o.PackLayouts == nil {
+		o.PackLayouts = []PackLayout{
+			{BytesPacked: 4, SuccessorBits: 3},
+			{BytesPacked: 2, SuccessorBits: 4},
+			{BytesPacked: 1, SuccessorBits: 5},
+		}
+	}
+	if o.MinByteFrequency <= 0 {
+		o.MinByteFrequency = 1
+	}
+	return o
+}
+
+// Stats reports how well a trained model fit its corpus.
+type Stats struct {
+	// CorpusBytes is the number of bytes read from the corpus.
+	CorpusBytes int
+
+	// SampledBytes and SampledCompressedBytes are the sizes of a
+	// round-tripped sample of the corpus, used to compute Ratio.
+	SampledBytes           int
+	SampledCompressedBytes int
+
+	// Ratio is SampledCompressedBytes / SampledBytes.
+	Ratio float64
+}
+
+// Train reads corpus to build unigram and bigram byte-frequency tables,
+// then fills a new *shoco.Model's successor tables with the most
+// frequent predecessor/successor pairs. It round-trips a sample of the
+// corpus through the resulting model to verify correctness and report
+// the achieved compression ratio.
+func Train(corpus io.Reader, opts TrainOptions) (*shoco.Model, Stats, error) {
+	opts = opts.withDefaults()
+
+	var bigrams [256][256]int
+
+	sample := make([]byte, 0, 64<<10)
+
+	br := bufio.NewReaderSize(corpus, 64<<10)
+	prev := -1
+	var stats Stats
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, Stats{}, fmt.Errorf("modelgen: reading corpus: %w", err)
+		}
+
+		stats.CorpusBytes++
+		if prev >= 0 {
+			bigrams[prev][b]++
+		}
+		prev = int(b)
+
+		if len(sample) < cap(sample) {
+			sample = append(sample, b)
+		}
+	}
+
+	if err := validatePackLayouts(opts.PackLayouts); err != nil {
+		return nil, Stats{}, err
+	}
+
+	// Solve the packing problem: a successor only earns a slot that any
+	// pack layout can address if its rank falls within that layout's
+	// addressable range, so there is no point training slots past the
+	// widest range any layout can reach - they would sit in the table
+	// but no Compress call could ever emit a token referencing them.
+	maxSlots := opts.MaxSuccessorID
+	if addressable := maxAddressableSuccessorID(opts.PackLayouts); addressable < maxSlots {
+		maxSlots = addressable
+	}
+
+	model := &shoco.Model{PackLayouts: opts.PackLayouts}
+
+	for chr := 0; chr < 256; chr++ {
+		type successor struct {
+			chr   byte
+			count int
+		}
+		successors := make([]successor, 0, 256)
+		for s, count := range bigrams[chr] {
+			if count >= opts.MinByteFrequency {
+				successors = append(successors, successor{byte(s), count})
+			}
+		}
+		sort.Slice(successors, func(i, j int) bool {
+			if successors[i].count != successors[j].count {
+				return successors[i].count > successors[j].count
+			}
+			return successors[i].chr < successors[j].chr
+		})
+		if len(successors) > maxSlots {
+			successors = successors[:maxSlots]
+		}
+
+		// SuccessorIDsByChrAndChr stores id+1, reserving zero to mean "no
+		// slot" (see Model's doc comment), so bytes that never made the
+		// cut need no explicit fill - they're already zero.
+		for id, s := range successors {
+			model.CharsByChrAndSuccessorID[chr][id] = s.chr
+			model.SuccessorIDsByChrAndChr[chr][s.chr] = int8(id + 1)
+		}
+	}
+
+	if opts.BuildEntropyHistogram {
+		residue := model.LiteralResidue(sample)
+
+		var raw [256]uint64
+		for _, b := range residue {
+			raw[b]++
+		}
+		for b, count := range raw {
+			if count == 0 {
+				raw[b] = 1 // fse.NewTable requires every symbol to have a nonzero count.
+			}
+		}
+		counts := fse.NormalizeCounts(raw, fse.MaxTableLog)
+		model.EntropyHistogram = &counts
+		model.EntropyTailEnabled = true
+	}
+
+	if len(sample) > 0 {
+		compressed := model.Compress(sample)
+		roundTripped, err := model.Decompress(compressed)
+		if err != nil {
+			return nil, Stats{}, fmt.Errorf("modelgen: round-trip failed: %w", err)
+		}
+		if string(roundTripped) != string(sample) {
+			return nil, Stats{}, fmt.Errorf("modelgen: round-trip mismatch on %d-byte sample", len(sample))
+		}
+
+		stats.SampledBytes = len(sample)
+		stats.SampledCompressedBytes = len(compressed)
+		stats.Ratio = float64(len(compressed)) / float64(len(sample))
+	}
+
+	return model, stats, nil
+}
+
+func validatePackLayouts(layouts []PackLayout) error {
+	for _, l := range layouts {
+		if l.BytesPacked <= 0 {
+			return fmt.Errorf("modelgen: pack layout has non-positive BytesPacked (%d)", l.BytesPacked)
+		}
+		if l.SuccessorBits == 0 {
+			return fmt.Errorf("modelgen: pack layout for %d bytes has zero SuccessorBits", l.BytesPacked)
+		}
+	}
+	return nil
+}
+
+// maxAddressableSuccessorID returns the widest successor-ID range any of
+// layouts can address, i.e. the largest 1<<SuccessorBits among them.
+func maxAddressableSuccessorID(layouts []PackLayout) int {
+	max := 0
+	for _, l := range layouts {
+		if n := 1 << l.SuccessorBits; n > max {
+			max = n
+		}
+	}
+	return max
+}
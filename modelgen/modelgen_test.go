@@ -0,0 +1,118 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package modelgen_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/storskegg/shoco/modelgen"
+)
+
+const sampleCorpus = `the quick brown fox jumps over the lazy dog
+the dog barks at the quick fox
+a fox and a dog are friends`
+
+func TestTrainRoundTrips(t *testing.T) {
+	model, stats, err := modelgen.Train(strings.NewReader(sampleCorpus), modelgen.TrainOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.SampledBytes == 0 {
+		t.Fatal("expected a non-empty sample to be measured")
+	}
+	if stats.Ratio <= 0 {
+		t.Fatalf("expected a positive compression ratio, got %f", stats.Ratio)
+	}
+
+	in := []byte("the quick fox")
+	compressed := model.Compress(in)
+	out, err := model.Decompress(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(in) {
+		t.Fatalf("got %q, want %q", out, in)
+	}
+}
+
+func TestTrainRespectsMaxSuccessorID(t *testing.T) {
+	model, _, err := modelgen.Train(strings.NewReader(sampleCorpus), modelgen.TrainOptions{
+		MaxSuccessorID: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stored values are one more than the successor's slot index (zero
+	// means "no slot"), so MaxSuccessorID: 2 allows stored values 0-2.
+	for chr, row := range model.SuccessorIDsByChrAndChr {
+		for _, id := range row {
+			if id > 2 {
+				t.Fatalf("chr %d: successor ID %d exceeds MaxSuccessorID of 2", chr, id)
+			}
+		}
+	}
+}
+
+func TestBuildEntropyHistogramReflectsResidueNotCorpus(t *testing.T) {
+	// "ab" repeated 200 times makes 'a' and 'b' by far the most frequent
+	// bytes in the raw corpus, but also earns 'a' a successor slot for
+	// 'b' that encodeTokens always takes, so neither byte ever surfaces
+	// in the literal-run residue. A unigram-based histogram would still
+	// weight them heavily; a residue-based one should weight them like
+	// any other byte that never appears in the residue, and instead
+	// weight the sentence's own bytes (which MinByteFrequency keeps out
+	// of the dictionary, since each of its bigrams occurs only once) by
+	// how often they actually occur in that residue - 'o' appears most,
+	// so it should outweigh 'a', 'b' and the rarer 'z'.
+	var corpus strings.Builder
+	for i := 0; i < 200; i++ {
+		corpus.WriteString("ab")
+	}
+	corpus.WriteString("The quick brown fox jumps over the lazy dog. Pack my box with five dozen liquor jugs.")
+
+	model, _, err := modelgen.Train(strings.NewReader(corpus.String()), modelgen.TrainOptions{
+		MinByteFrequency:      5,
+		BuildEntropyHistogram: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.EntropyHistogram == nil {
+		t.Fatal("expected BuildEntropyHistogram to populate EntropyHistogram")
+	}
+
+	hist := *model.EntropyHistogram
+	if hist['o'] <= hist['a'] || hist['o'] <= hist['b'] {
+		t.Fatalf("histogram should weight residue-heavy 'o' (%d) above dictionary-absorbed 'a' (%d) and 'b' (%d), "+
+			"which a whole-corpus unigram histogram would have gotten backwards", hist['o'], hist['a'], hist['b'])
+	}
+	if hist['o'] <= hist['z'] {
+		t.Fatalf("'o' occurs more often than 'z' in the residue, want hist['o'] (%d) > hist['z'] (%d)", hist['o'], hist['z'])
+	}
+}
+
+func TestWriteGoSource(t *testing.T) {
+	model, _, err := modelgen.Train(strings.NewReader(sampleCorpus), modelgen.TrainOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := modelgen.WriteGoSource(&buf, "models", "Sample", model); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "package models") {
+		t.Fatalf("generated source missing package clause:\n%s", out)
+	}
+	if !strings.Contains(out, "func Sample() *shoco.Model") {
+		t.Fatalf("generated source missing Sample constructor:\n%s", out)
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package models provides a handful of ready-made *shoco.Model values
+// for common kinds of short strings, each trained with modelgen.Train
+// from a small representative corpus. Use modelgen directly to train a
+// model tuned to your own data.
+package models
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/storskegg/shoco"
+	"github.com/storskegg/shoco/modelgen"
+)
+
+func trainOnce(once *sync.Once, model **shoco.Model, name, corpus string) *shoco.Model {
+	once.Do(func() {
+		m, _, err := modelgen.Train(strings.NewReader(corpus), modelgen.TrainOptions{
+			BuildEntropyHistogram: true,
+		})
+		if err != nil {
+			panic("models: training " + name + ": " + err.Error())
+		}
+		m.Name = name
+		*model = m
+	})
+	return *model
+}
+
+var (
+	wordsEnOnce  sync.Once
+	wordsEnModel *shoco.Model
+)
+
+// WordsEn returns a Model trained on a sample of common English words,
+// one per line, suitable for compressing dictionary words, usernames,
+// and similar short identifiers.
+func WordsEn() *shoco.Model {
+	return trainOnce(&wordsEnOnce, &wordsEnModel, "WordsEn", wordsEnCorpus)
+}
+
+var (
+	textEnOnce  sync.Once
+	textEnModel *shoco.Model
+)
+
+// TextEn returns a Model trained on ordinary English prose, suitable
+// for compressing sentences, log messages, and similar free-form text.
+func TextEn() *shoco.Model {
+	return trainOnce(&textEnOnce, &textEnModel, "TextEn", textEnCorpus)
+}
+
+var (
+	filePathOnce  sync.Once
+	filePathModel *shoco.Model
+)
+
+// FilePath returns a Model trained on Unix-style file paths.
+func FilePath() *shoco.Model {
+	return trainOnce(&filePathOnce, &filePathModel, "FilePath", filePathCorpus)
+}
+
+var (
+	emailsOnce  sync.Once
+	emailsModel *shoco.Model
+)
+
+// Emails returns a Model trained on email addresses.
+func Emails() *shoco.Model {
+	return trainOnce(&emailsOnce, &emailsModel, "Emails", emailsCorpus)
+}
+
+const wordsEnCorpus = `the
+of
+and
+a
+to
+in
+is
+you
+that
+it
+he
+was
+for
+on
+are
+as
+with
+his
+they
+at
+be
+this
+have
+from
+or
+one
+had
+by
+word
+but
+not
+what
+all
+were
+we
+when
+your
+can
+said
+there
+use
+an
+each
+which
+she
+do
+how
+their
+if
+will
+up
+other
+about
+out
+many
+then
+them
+these
+so
+some
+her
+would
+make
+like
+him
+into
+time
+has
+look
+two
+more
+write
+go
+see
+number
+no
+way
+could
+people
+my
+than
+first
+water
+been
+call
+who
+oil
+its
+now
+find
+long
+down
+day
+did
+get
+come
+made
+may
+part
+over
+new
+sound
+take
+only
+little
+work
+know
+place
+year
+live
+me
+back
+give
+most
+very
+after
+thing
+our
+just
+name
+good
+sentence
+man
+think
+say
+great
+where
+help
+through
+much
+before
+line
+right
+too
+mean
+old
+any
+same
+tell
+boy
+follow
+came
+want
+show
+also
+around
+form
+three
+small
+set
+put
+end
+does
+another
+well
+large
+must
+big
+even
+such
+because
+turn
+here
+why
+ask
+went
+men
+read
+need
+land
+different
+home
+us
+move
+try
+kind
+hand
+picture
+again
+change
+off
+play
+spell
+air
+away
+animal
+house
+point
+page
+letter
+mother
+answer
+found
+study
+still
+learn
+should
+america
+world
+`
+
+const textEnCorpus = `The quick brown fox jumps over the lazy dog. A journey of a thousand miles begins with a single step.
+All that glitters is not gold. Actions speak louder than words. Better late than never.
+Every cloud has a silver lining. The early bird catches the worm. Honesty is the best policy.
+Practice makes perfect. Time heals all wounds. Where there is a will there is a way.
+Shoco is a C library to compress and decompress short strings. It is very fast and easy to use.
+The default compression model is optimized for English words, but you can generate your own
+compression model based on your specific input data. This lets callers tune the size and speed
+tradeoff to their own corpus rather than relying on a single fixed dictionary.
+Log lines, chat messages, and short status updates all compress well once a model has seen
+enough of the same kind of text to learn which letters tend to follow which other letters.
+`
+
+const filePathCorpus = `/usr/bin/env
+/usr/local/bin/go
+/home/user/projects/shoco/main.go
+/home/user/projects/shoco/models/models.go
+/var/log/syslog
+/var/log/messages
+/etc/passwd
+/etc/hosts
+/etc/nginx/nginx.conf
+/opt/homebrew/bin/brew
+/tmp/build/output.bin
+/tmp/cache/objects/a1/b2c3d4
+/root/.config/git/config
+/root/module/go.mod
+/srv/www/html/index.html
+/mnt/data/backups/2016-01-01.tar.gz
+/dev/null
+/proc/self/status
+/usr/share/dict/words
+/usr/include/stdio.h
+`
+
+const emailsCorpus = `user@example.com
+admin@example.com
+support@example.com
+info@example.org
+jane.doe@company.com
+john.smith@company.com
+contact@service.io
+noreply@service.io
+sales@business.net
+hello@startup.dev
+webmaster@example.com
+postmaster@example.com
+first.last@mail.example.com
+a.b.c@sub.example.co.uk
+test123@example.com
+`
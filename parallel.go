@@ -0,0 +1,270 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+import (
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Boundary chooses where CompressParallel is allowed to split in, by
+// returning the index of a safe cut point at or before a rough target
+// length, or -1 if none exists before the end of in. A Model's
+// ParallelOptions.Boundary should return an index i such that splitting
+// in[:i] and in[i:] into two independently compressed records never
+// changes what Decompress(CompressParallel(in, ...)) produces, i.e. i
+// must fall between two logical records (a newline, a path separator,
+// an '@', ...), never inside one.
+type Boundary func(in []byte, after int) int
+
+// ParallelOptions configures CompressParallel and DecompressParallel.
+type ParallelOptions struct {
+	// Concurrency is the number of worker goroutines to use. Defaults
+	// to runtime.GOMAXPROCS(0) if zero or negative.
+	Concurrency int
+
+	// ChunkSize is the rough target, in bytes, for each chunk before
+	// Boundary snaps it to a safe cut point. Defaults to 64KiB if zero
+	// or negative.
+	ChunkSize int
+
+	// Boundary picks safe split points within in. Defaults to
+	// splitting on '\n' if nil.
+	Boundary Boundary
+}
+
+func (o ParallelOptions) withDefaults() ParallelOptions {
+	if o.Concurrency <= 0 {
+		o.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = 64 << 10
+	}
+	if o.Boundary == nil {
+		o.Boundary = NewlineBoundary
+	}
+	return o
+}
+
+// NewlineBoundary is a Boundary that splits after the last '\n' at or
+// before the target offset, suitable for line-oriented text models such
+// as models.TextEn and models.WordsEn.
+func NewlineBoundary(in []byte, after int) int {
+	if after >= len(in) {
+		return -1
+	}
+	for i := after; i >= 0; i-- {
+		if in[i] == '\n' {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// PathBoundary is a Boundary that splits after the last '/' at or before
+// the target offset, suitable for models.FilePath.
+func PathBoundary(in []byte, after int) int {
+	if after >= len(in) {
+		return -1
+	}
+	for i := after; i >= 0; i-- {
+		if in[i] == '/' {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// EmailBoundary is a Boundary that splits after the last '@' or '.' at
+// or before the target offset, suitable for models.Emails.
+func EmailBoundary(in []byte, after int) int {
+	if after >= len(in) {
+		return -1
+	}
+	for i := after; i >= 0; i-- {
+		if in[i] == '@' || in[i] == '.' {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// ASCIIBoundary returns a Boundary that splits every n bytes, snapped
+// forward to the next ASCII byte (high bit clear) so a multi-byte UTF-8
+// sequence is never cut in half.
+func ASCIIBoundary(n int) Boundary {
+	return func(in []byte, after int) int {
+		if after >= len(in) {
+			return -1
+		}
+		for i := after; i < len(in); i++ {
+			if in[i]&0x80 == 0 {
+				return i
+			}
+		}
+		return -1
+	}
+}
+
+// ErrTruncatedIndex is returned by DecompressParallel when the index
+// header is missing, truncated, or doesn't match the remaining input.
+var ErrTruncatedIndex = errors.New("shoco: truncated parallel chunk index")
+
+// runWorkerPool runs work(i) for each i in [0, numJobs) across a fixed
+// pool of concurrency worker goroutines, returning once every job has
+// completed.
+func runWorkerPool(numJobs, concurrency int, work func(i int)) {
+	if numJobs == 0 {
+		return
+	}
+	if concurrency > numJobs {
+		concurrency = numJobs
+	}
+
+	jobs := make(chan int, numJobs)
+	for i := 0; i < numJobs; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for w := 0; w < concurrency; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				work(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// splitChunks divides in into boundary-aligned chunks no larger than
+// roughly opts.ChunkSize.
+func splitChunks(in []byte, opts ParallelOptions) [][]byte {
+	var chunks [][]byte
+	for len(in) > 0 {
+		if len(in) <= opts.ChunkSize {
+			chunks = append(chunks, in)
+			break
+		}
+
+		cut := opts.Boundary(in, opts.ChunkSize)
+		if cut <= 0 {
+			cut = len(in)
+		}
+		chunks = append(chunks, in[:cut])
+		in = in[cut:]
+	}
+	return chunks
+}
+
+// CompressParallel compresses in using model, splitting the work across
+// up to opts.Concurrency worker goroutines. Each chunk is compressed
+// with the same Model.Compress used by the single-threaded path, so the
+// payload embedded for any one chunk - including the only chunk of a
+// one-chunk input - is byte-identical to what Compress would produce
+// for that chunk on its own. The chunks are then wrapped in a small
+// index header, so the overall CompressParallel output is always larger
+// than plain Compress by that header's size, even for a single chunk;
+// DecompressParallel uses the header to fan the work back out
+// symmetrically:
+//
+//	varint(num_chunks) || num_chunks * {varint(uncompressed_len), varint(compressed_len)} || chunk_0 || chunk_1 || ...
+func CompressParallel(in []byte, model *Model, opts ParallelOptions) []byte {
+	opts = opts.withDefaults()
+
+	chunks := splitChunks(in, opts)
+	compressed := make([][]byte, len(chunks))
+
+	runWorkerPool(len(chunks), opts.Concurrency, func(i int) {
+		compressed[i] = model.Compress(chunks[i])
+	})
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(chunks)))
+	out := append([]byte(nil), lenBuf[:n]...)
+
+	for i, chunk := range chunks {
+		n := binary.PutUvarint(lenBuf[:], uint64(len(chunk)))
+		out = append(out, lenBuf[:n]...)
+		n = binary.PutUvarint(lenBuf[:], uint64(len(compressed[i])))
+		out = append(out, lenBuf[:n]...)
+	}
+	for _, c := range compressed {
+		out = append(out, c...)
+	}
+
+	return out
+}
+
+// DecompressParallel reverses CompressParallel, decompressing each
+// chunk concurrently across up to opts.Concurrency worker goroutines.
+func DecompressParallel(in []byte, model *Model, opts ParallelOptions) ([]byte, error) {
+	opts = opts.withDefaults()
+
+	numChunks, n := binary.Uvarint(in)
+	if n <= 0 {
+		return nil, ErrTruncatedIndex
+	}
+	in = in[n:]
+
+	type chunkLen struct {
+		uncompressed, compressed uint64
+	}
+	lens := make([]chunkLen, numChunks)
+	for i := range lens {
+		u, n := binary.Uvarint(in)
+		if n <= 0 {
+			return nil, ErrTruncatedIndex
+		}
+		in = in[n:]
+
+		c, n := binary.Uvarint(in)
+		if n <= 0 {
+			return nil, ErrTruncatedIndex
+		}
+		in = in[n:]
+
+		lens[i] = chunkLen{u, c}
+	}
+
+	chunks := make([][]byte, numChunks)
+	for i, l := range lens {
+		if uint64(len(in)) < l.compressed {
+			return nil, ErrTruncatedIndex
+		}
+		chunks[i] = in[:l.compressed]
+		in = in[l.compressed:]
+	}
+
+	results := make([][]byte, numChunks)
+	errs := make([]error, numChunks)
+
+	runWorkerPool(len(chunks), opts.Concurrency, func(i int) {
+		results[i], errs[i] = model.Decompress(chunks[i])
+	})
+
+	var total int
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(results[i])) != lens[i].uncompressed {
+			return nil, ErrTruncatedIndex
+		}
+		total += len(results[i])
+	}
+
+	out := make([]byte, 0, total)
+	for _, r := range results {
+		out = append(out, r...)
+	}
+	return out, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco_test
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/storskegg/shoco"
+	"github.com/storskegg/shoco/models"
+)
+
+func TestCompressParallelRoundTrip(t *testing.T) {
+	lines := make([]string, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, "the quick brown fox jumps over the lazy dog")
+	}
+	in := []byte(strings.Join(lines, "\n"))
+
+	model := models.WordsEn()
+	for _, concurrency := range []int{0, 1, 4} {
+		opts := shoco.ParallelOptions{Concurrency: concurrency, ChunkSize: 256}
+
+		compressed := shoco.CompressParallel(in, model, opts)
+		out, err := shoco.DecompressParallel(compressed, model, opts)
+		if err != nil {
+			t.Fatalf("concurrency=%d: %v", concurrency, err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Fatalf("concurrency=%d: round trip mismatch", concurrency)
+		}
+	}
+}
+
+func TestCompressParallelSingleChunkMatchesCompress(t *testing.T) {
+	model := models.WordsEn()
+	in := []byte("shoco is a C library to compress and decompress short strings.")
+
+	plain := model.Compress(in)
+	parallel := shoco.CompressParallel(in, model, shoco.ParallelOptions{ChunkSize: len(in) + 1})
+
+	out, err := shoco.DecompressParallel(parallel, model, shoco.ParallelOptions{ChunkSize: len(in) + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Fatalf("got %q, want %q", out, in)
+	}
+
+	// The sole chunk's payload, found after the index header, must be
+	// byte-identical to plain Model.Compress's output for the same
+	// bytes - the index header is the only thing CompressParallel adds.
+	if !bytes.HasSuffix(parallel, plain) {
+		t.Fatalf("parallel output %x does not end with plain Compress output %x", parallel, plain)
+	}
+}
+
+func TestNewlineBoundaryNeverSplitsMidLine(t *testing.T) {
+	in := []byte("aaaa\nbbbb\ncccc\ndddd\n")
+	cut := shoco.NewlineBoundary(in, 6)
+	if cut < 0 || in[cut-1] != '\n' {
+		t.Fatalf("cut=%d does not fall right after a newline", cut)
+	}
+}
+
+func BenchmarkWordsParallel(b *testing.B) {
+	f, err := os.Open("/usr/share/dict/words")
+	if err != nil {
+		if os.IsNotExist(err) {
+			b.Skip("/usr/share/dict/words does not exist")
+		}
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	in, err := ioutil.ReadAll(bufio.NewReader(f))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	model := models.WordsEn()
+	opts := shoco.ParallelOptions{}
+
+	b.Run("Compress", func(b *testing.B) {
+		b.SetBytes(int64(len(in)))
+		for n := 0; n < b.N; n++ {
+			_ = shoco.CompressParallel(in, model, opts)
+		}
+	})
+
+	compressed := shoco.CompressParallel(in, model, opts)
+	b.Run("Decompress", func(b *testing.B) {
+		b.SetBytes(int64(len(compressed)))
+		for n := 0; n < b.N; n++ {
+			if _, err := shoco.DecompressParallel(compressed, model, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
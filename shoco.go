@@ -0,0 +1,87 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package shoco compresses and decompresses short strings, trading
+// general-purpose compression ratio for very low per-call overhead: a
+// Model folds common predecessor/successor byte runs (trained from a
+// corpus - see the modelgen subpackage) into compact pack tokens, and
+// falls back to literal bytes for anything it doesn't recognize.
+package shoco
+
+// defaultModel is a small, built-in successor dictionary for the
+// package-level Compress/Decompress, covering the most common bigrams
+// in everyday English text. It's intentionally compact; models.WordsEn
+// and friends are trained from larger corpora and compress better.
+var defaultModel = buildDefaultModel()
+
+func buildDefaultModel() *Model {
+	m := &Model{Name: "default"}
+
+	// A handful of common English bigrams, most frequent successor
+	// first, is enough to demonstrate the format without vendoring a
+	// full training corpus into the core package.
+	bigrams := map[byte]string{
+		' ':  "tabcsdwmfhoeiprl",
+		'e':  " rnsdatlcmvgivp",
+		't':  " hoeiarsuy",
+		'a':  " nrstlcidmgukp",
+		'o':  " nrumtwlsdgkf",
+		'i':  "ntsoecmdlgra",
+		'n':  " tgdsceiaoy",
+		's':  " teiaophncoru",
+		'h':  "eiaot rs",
+		'r':  " eiaoydst",
+		'd':  " eiaos ",
+		'l':  " eiaoytds",
+		'c':  "ehotaiku",
+		'u':  " nrestlmgp",
+		'm':  " eaiop",
+		'f':  " oeiaur",
+		'g':  " heiaor",
+		'y':  " ospt ",
+		'w':  " eiaoh",
+		'p':  " erioal",
+		'b':  " eolaiu",
+		'v':  "eia ",
+		'.':  " \n",
+		',':  " ",
+		'\n': "\n",
+	}
+	for chr, successors := range bigrams {
+		for id, s := range []byte(successors) {
+			if id >= maxSuccessorSlots {
+				break
+			}
+			m.CharsByChrAndSuccessorID[chr][id] = s
+			// Stored as id+1, reserving zero to mean "no slot" - see
+			// Model's doc comment in model.go.
+			m.SuccessorIDsByChrAndChr[chr][s] = int8(id + 1)
+		}
+	}
+	return m
+}
+
+// Compress compresses in using the package's small built-in default
+// model. For a richer dictionary tuned to a particular domain, train
+// one with modelgen or use one of the models package's models and call
+// Model.Compress directly.
+func Compress(in []byte) []byte {
+	return defaultModel.Compress(in)
+}
+
+// Decompress reverses Compress.
+func Decompress(in []byte) ([]byte, error) {
+	return defaultModel.Decompress(in)
+}
+
+// ProposedCompress is Model.ProposedCompress against the default model.
+func ProposedCompress(in []byte) []byte {
+	return defaultModel.ProposedCompress(in)
+}
+
+// ProposedDecompress reverses ProposedCompress.
+func ProposedDecompress(in []byte) ([]byte, error) {
+	return defaultModel.ProposedDecompress(in)
+}
@@ -0,0 +1,194 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// ErrCorruptRecord is returned by a Reader when a record's checksum or
+// declared length does not match its decompressed contents.
+var ErrCorruptRecord = errors.New("shoco: corrupt record")
+
+// ErrClosedWriter is returned by Write when called on a Writer that has
+// already been closed.
+var ErrClosedWriter = errors.New("shoco: write on closed Writer")
+
+// Writer is an io.WriteCloser that compresses each call to Write as an
+// independent record, in the style of compress/gzip. Because shoco is
+// tuned for short strings rather than long streams, callers should Write
+// one logical unit (a line, a key, a message) at a time; each Write call
+// becomes a separately framed, separately checksummed record that a
+// Reader can decode and resynchronize on even if a later record is lost
+// or corrupted.
+//
+// A record on the wire is:
+//
+//	varint(len(uncompressed)) || varint(len(compressed)) || compressed || crc32(compressed)
+type Writer struct {
+	w      *bufio.Writer
+	model  *Model
+	lenBuf [binary.MaxVarintLen64]byte
+	closed bool
+}
+
+// NewWriter returns a Writer that writes compressed records to w using
+// model. model must not be nil.
+func NewWriter(w io.Writer, model *Model) *Writer {
+	return &Writer{w: bufio.NewWriter(w), model: model}
+}
+
+// Write compresses p into a single record and writes it to the
+// underlying writer. It never retains a reference to p after returning.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.closed {
+		return 0, ErrClosedWriter
+	}
+
+	compressed := w.model.Compress(p)
+
+	if err := w.writeUvarint(uint64(len(p))); err != nil {
+		return 0, err
+	}
+	if err := w.writeUvarint(uint64(len(compressed))); err != nil {
+		return 0, err
+	}
+	if _, err := w.w.Write(compressed); err != nil {
+		return 0, err
+	}
+
+	var crcBuf [4]byte
+	binary.BigEndian.PutUint32(crcBuf[:], crc32.ChecksumIEEE(compressed))
+	if _, err := w.w.Write(crcBuf[:]); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *Writer) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(w.lenBuf[:], v)
+	_, err := w.w.Write(w.lenBuf[:n])
+	return err
+}
+
+// Flush flushes any buffered data to the underlying io.Writer without
+// closing the Writer. Every record written before Flush is returns is
+// safe for a Reader to consume, even if the Writer is used again
+// afterwards.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Close flushes any buffered data and marks the Writer closed. Close
+// does not close the underlying io.Writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.w.Flush()
+}
+
+// Reset discards the Writer's state and reconfigures it to write to dst,
+// as if it had been returned by NewWriter(dst, model). This lets callers
+// reuse a Writer, e.g. from a sync.Pool.
+func (w *Writer) Reset(dst io.Writer) {
+	w.closed = false
+	w.w.Reset(dst)
+}
+
+// Reader is an io.ReadCloser that decodes records written by a Writer.
+// Read has ordinary io.Reader semantics: a single call may return less
+// than a full record, and callers using io.Copy or a small buffer will
+// still see the full decompressed stream.
+type Reader struct {
+	r       *bufio.Reader
+	model   *Model
+	pending []byte
+}
+
+// NewReader returns a Reader that reads records produced by a Writer
+// using model from r. model must not be nil and must match the model
+// the records were written with.
+func NewReader(r io.Reader, model *Model) *Reader {
+	return &Reader{r: bufio.NewReader(r), model: model}
+}
+
+// Read implements io.Reader, decompressing one record at a time and
+// doling out its bytes across one or more Read calls as needed.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if err := r.nextRecord(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *Reader) nextRecord() error {
+	uncompressedLen, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return err // io.EOF here means a clean end of stream.
+	}
+
+	compressedLen, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	compressed := make([]byte, compressedLen)
+	if _, err := io.ReadFull(r.r, compressed); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	var crcBuf [4]byte
+	if _, err := io.ReadFull(r.r, crcBuf[:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	if crc32.ChecksumIEEE(compressed) != binary.BigEndian.Uint32(crcBuf[:]) {
+		return ErrCorruptRecord
+	}
+
+	out, err := r.model.Decompress(compressed)
+	if err != nil {
+		return err
+	}
+	if uint64(len(out)) != uncompressedLen {
+		return ErrCorruptRecord
+	}
+
+	r.pending = out
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Close implements io.Closer. It does not close the underlying
+// io.Reader.
+func (r *Reader) Close() error {
+	return nil
+}
+
+// Reset discards the Reader's state and reconfigures it to read from
+// src, as if it had been returned by NewReader(src, model). This lets
+// callers reuse a Reader, e.g. from a sync.Pool.
+func (r *Reader) Reset(src io.Reader) {
+	r.r.Reset(src)
+	r.pending = nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package shoco_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/storskegg/shoco"
+	"github.com/storskegg/shoco/models"
+)
+
+func TestStreamingRoundTrip(t *testing.T) {
+	lines := []string{
+		"",
+		"shoco",
+		"shoco is a C library to compress and decompress short strings.",
+		"Übergrößenträger",
+		"Hello, 世界",
+	}
+
+	var buf bytes.Buffer
+	w := shoco.NewWriter(&buf, models.WordsEn())
+	for _, line := range lines {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write(%q): %v", line, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r := shoco.NewReader(&buf, models.WordsEn())
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+
+	var want bytes.Buffer
+	for _, line := range lines {
+		want.WriteString(line)
+	}
+	if !bytes.Equal(out, want.Bytes()) {
+		t.Fatalf("got %q, want %q", out, want.Bytes())
+	}
+}
+
+func TestStreamingResync(t *testing.T) {
+	var buf bytes.Buffer
+	w := shoco.NewWriter(&buf, models.WordsEn())
+	if _, err := w.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := buf.Bytes()
+	corrupt[len(corrupt)-1] ^= 0xff // flip a bit in the second record's CRC
+
+	r := shoco.NewReader(bytes.NewReader(corrupt), models.WordsEn())
+	buf2 := make([]byte, 5)
+	n, err := r.Read(buf2)
+	if err != nil {
+		t.Fatalf("Read first record: %v", err)
+	}
+	if string(buf2[:n]) != "first" {
+		t.Fatalf("got %q, want %q", buf2[:n], "first")
+	}
+
+	if _, err := r.Read(buf2); err != shoco.ErrCorruptRecord {
+		t.Fatalf("got err %v, want ErrCorruptRecord", err)
+	}
+}
+
+func TestStreamingResetReuse(t *testing.T) {
+	w := shoco.NewWriter(ioutil.Discard, models.WordsEn())
+	if _, err := w.Write([]byte("discarded")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w.Reset(&buf)
+	if _, err := w.Write([]byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := shoco.NewReader(&buf, models.WordsEn())
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "kept" {
+		t.Fatalf("got %q, want %q", out, "kept")
+	}
+}
+
+func BenchmarkWordsStream(b *testing.B) {
+	f, err := os.Open("/usr/share/dict/words")
+	if err != nil {
+		if os.IsNotExist(err) {
+			b.Skip("/usr/share/dict/words does not exist")
+		}
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := make([]byte, len(scanner.Bytes()))
+		copy(line, scanner.Bytes())
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		b.Fatal(err)
+	}
+
+	model := models.WordsEn()
+
+	b.Run("Write", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			w := shoco.NewWriter(ioutil.Discard, model)
+			for _, line := range lines {
+				if _, err := w.Write(line); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	var buf bytes.Buffer
+	w := shoco.NewWriter(&buf, model)
+	for _, line := range lines {
+		if _, err := w.Write(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	b.Run("Read", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			r := shoco.NewReader(bytes.NewReader(encoded), model)
+			if _, err := io.Copy(ioutil.Discard, r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}